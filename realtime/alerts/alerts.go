@@ -0,0 +1,116 @@
+// Package alerts scrapes service alerts from wtp.waw.pl and turns them into a
+// GTFS-Realtime Alerts feed, linking each alert to the GTFS routes it
+// mentions.
+package alerts
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/MKuranowski/WarsawGTFS/realtime/gtfs"
+	"github.com/MKuranowski/WarsawGTFS/realtime/metrics"
+	"github.com/MKuranowski/WarsawGTFS/realtime/sink"
+	"github.com/MKuranowski/WarsawGTFS/realtime/util"
+)
+
+// Options controls the behavior of Make and Loop.
+type Options struct {
+	// Sink is where the generated feed files are published.
+	Sink sink.Sink
+
+	GtfsRtName    string
+	JSONName      string
+	HumanReadable bool
+
+	// ThrowLinkErrors makes Make fail when a scraped alert mentions a line
+	// that isn't in the static GTFS, instead of skipping just that alert.
+	ThrowLinkErrors bool
+
+	// Metrics, if set, receives build duration, entity count and fetch error
+	// instrumentation for this feed.
+	Metrics *metrics.Registry
+
+	// Logger receives structured progress and debug logs; defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// logger returns opts.Logger, falling back to slog.Default() if unset.
+func (opts Options) logger() *slog.Logger {
+	if opts.Logger != nil {
+		return opts.Logger
+	}
+	return slog.Default()
+}
+
+// Make scrapes the current wtp.waw.pl alerts, links each one to the GTFS
+// routes it affects and writes a GTFS-Realtime Alerts feed to
+// opts.GtfsRtName (and opts.JSONName, if set) through opts.Sink.
+func Make(client *http.Client, routes gtfs.Routes, opts Options) error {
+	start := time.Now()
+
+	raw, err := fetchAlerts(client)
+	if err != nil {
+		opts.incFetchErrors("wtp.waw.pl", 1)
+		return err
+	}
+
+	var linked []linkedAlert
+	for _, a := range raw {
+		opts.logger().Debug("Scraped alert", "id", a.ID, "header", a.Header, "lines", a.Lines)
+
+		routeIDs, err := linkRoutes(a.Lines, routes)
+		if err != nil {
+			if opts.ThrowLinkErrors {
+				return err
+			}
+			opts.logger().Warn("Skipping alert with unlinkable route", "id", a.ID, "error", err)
+			continue
+		}
+		linked = append(linked, linkedAlert{rawAlert: a, RouteIDs: routeIDs})
+	}
+
+	if err := writeFeed(linked, opts); err != nil {
+		return err
+	}
+
+	if opts.Metrics != nil {
+		opts.Metrics.SetGauge("alerts_entity_count", float64(len(linked)))
+		opts.Metrics.ObserveDuration("alerts_build_duration_seconds", time.Since(start))
+		opts.Metrics.MarkBuildSuccess(time.Now())
+	}
+	return nil
+}
+
+// incFetchErrors increments the fetch-errors-by-source counter, if opts.Metrics is set.
+func (opts Options) incFetchErrors(source string, delta float64) {
+	if opts.Metrics != nil {
+		opts.Metrics.IncCounter(`fetch_errors_total{source="`+source+`"}`, delta)
+	}
+}
+
+// Loop calls Make every interval, fetching the current GTFS from gtfsSrc
+// (which reloads it only when its underlying Resource reports new content).
+// gtfsSrc may be shared with other loops, e.g. by the "all" subcommand, so
+// the static GTFS is parsed at most once per change no matter how many
+// feeds are being generated.
+func Loop(client *http.Client, gtfsSrc *util.GtfsSupplier, interval time.Duration, opts Options) error {
+	for {
+		gtfsFile, err := gtfsSrc.Get()
+		if err != nil {
+			opts.incFetchErrors("GTFS mirror", 1)
+			opts.logger().Error("Error reloading GTFS for alerts", "error", err)
+			time.Sleep(interval)
+			continue
+		}
+		if gtfsFile.Routes == nil {
+			return errNoRoutes
+		}
+
+		if err := Make(client, gtfsFile.Routes, opts); err != nil {
+			opts.logger().Error("Error creating alerts feed", "error", err)
+		}
+
+		time.Sleep(interval)
+	}
+}
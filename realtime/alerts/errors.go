@@ -0,0 +1,7 @@
+package alerts
+
+import "errors"
+
+// errNoRoutes is returned when a GTFS archive has no routes.txt to link
+// scraped alerts against.
+var errNoRoutes = errors.New("no file routes.txt in the GTFS")
@@ -0,0 +1,40 @@
+package alerts
+
+import (
+	"fmt"
+
+	"github.com/MKuranowski/WarsawGTFS/realtime/gtfs"
+)
+
+// rawAlert is one entry of the wtp.waw.pl alerts feed.
+type rawAlert struct {
+	ID     string   `json:"id"`
+	Header string   `json:"header"`
+	Body   string   `json:"body"`
+	Lines  []string `json:"lines"`
+}
+
+// linkedAlert is a rawAlert resolved to the GTFS route_ids it affects.
+type linkedAlert struct {
+	rawAlert
+	RouteIDs []string
+}
+
+// linkRoutes resolves each wtp.waw.pl line number mentioned by an alert to
+// its GTFS route_id, by matching against route_short_name.
+func linkRoutes(lines []string, routes gtfs.Routes) ([]string, error) {
+	byShortName := make(map[string]string, len(routes))
+	for id, r := range routes {
+		byShortName[r.ShortName] = id
+	}
+
+	ids := make([]string, 0, len(lines))
+	for _, line := range lines {
+		id, ok := byShortName[line]
+		if !ok {
+			return nil, fmt.Errorf("alert references unknown line %q", line)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
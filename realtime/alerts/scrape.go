@@ -0,0 +1,24 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// alertsURL is the wtp.waw.pl endpoint listing currently active service alerts.
+const alertsURL = "https://www.wtp.waw.pl/wp-json/wtp/v1/alerts"
+
+// fetchAlerts retrieves the current snapshot of wtp.waw.pl service alerts.
+func fetchAlerts(client *http.Client) ([]rawAlert, error) {
+	resp, err := client.Get(alertsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var alerts []rawAlert
+	if err := json.NewDecoder(resp.Body).Decode(&alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
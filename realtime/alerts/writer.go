@@ -0,0 +1,71 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// writeFeed serializes alerts as a GTFS-Realtime FeedMessage of Alert
+// entities and publishes it through opts.Sink as opts.GtfsRtName (and
+// opts.JSONName, if set).
+func writeFeed(alerts []linkedAlert, opts Options) error {
+	msg := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
+			GtfsRealtimeVersion: proto.String("2.0"),
+			Incrementality:      gtfsrt.FeedHeader_FULL_DATASET.Enum(),
+			Timestamp:           proto.Uint64(uint64(time.Now().Unix())),
+		},
+	}
+
+	for _, a := range alerts {
+		entity := &gtfsrt.FeedEntity{
+			Id: proto.String(a.ID),
+			Alert: &gtfsrt.Alert{
+				HeaderText:      translatedString(a.Header),
+				DescriptionText: translatedString(a.Body),
+			},
+		}
+		for _, routeID := range a.RouteIDs {
+			entity.Alert.InformedEntity = append(entity.Alert.InformedEntity,
+				&gtfsrt.EntitySelector{RouteId: proto.String(routeID)})
+		}
+		msg.Entity = append(msg.Entity, entity)
+	}
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if err := opts.Sink.Write(context.Background(), opts.GtfsRtName, data); err != nil {
+		return err
+	}
+
+	if opts.JSONName == "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if opts.HumanReadable {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(alerts); err != nil {
+		return err
+	}
+	return opts.Sink.Write(context.Background(), opts.JSONName, buf.Bytes())
+}
+
+// translatedString wraps a plain-Polish string as the single-translation
+// TranslatedString the GTFS-Realtime spec requires for alert text fields.
+func translatedString(text string) *gtfsrt.TranslatedString {
+	return &gtfsrt.TranslatedString{
+		Translation: []*gtfsrt.TranslatedString_Translation{
+			{Text: proto.String(text), Language: proto.String("pl")},
+		},
+	}
+}
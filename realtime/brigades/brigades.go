@@ -0,0 +1,142 @@
+// Package brigades derives brigades.json — the mapping from a route+brigade
+// pair to the trips a single physical vehicle works that day, listed in no
+// defined order — from the static GTFS, so positions and tripupdates can correlate live AVL
+// fixes (which only report line and brigade number) to scheduled trips.
+package brigades
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/MKuranowski/WarsawGTFS/realtime/gtfs"
+	"github.com/MKuranowski/WarsawGTFS/realtime/metrics"
+	"github.com/MKuranowski/WarsawGTFS/realtime/sink"
+	"github.com/MKuranowski/WarsawGTFS/realtime/util"
+)
+
+// Options controls the behavior of Main and Loop.
+type Options struct {
+	// Sink is where the generated brigades.json is published.
+	Sink sink.Sink
+
+	JSONName string
+
+	// ThrowAPIErrors makes Loop return on the first error instead of logging
+	// it and retrying on the next iteration.
+	ThrowAPIErrors bool
+
+	// Metrics, if set, receives build duration, entity count and fetch error
+	// instrumentation for this feed.
+	Metrics *metrics.Registry
+
+	// Logger receives structured progress and debug logs; defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// logger returns opts.Logger, falling back to slog.Default() if unset.
+func (opts Options) logger() *slog.Logger {
+	if opts.Logger != nil {
+		return opts.Logger
+	}
+	return slog.Default()
+}
+
+// brigade is one brigade's scheduled trips for the day.
+type brigade struct {
+	Trips []string `json:"trips"`
+}
+
+// Main groups gtfsFile's trips by route and block_id (a block being the
+// sequence of trips one physical vehicle works), assigns each block a
+// brigade number, and writes the result as brigades.json through opts.Sink.
+func Main(client *http.Client, gtfsFile *gtfs.Gtfs, opts Options) error {
+	start := time.Now()
+
+	byRoute := make(map[string]map[string][]gtfs.Trip)
+	for _, t := range gtfsFile.Trips {
+		if t.BlockID == "" {
+			continue
+		}
+		if byRoute[t.RouteID] == nil {
+			byRoute[t.RouteID] = make(map[string][]gtfs.Trip)
+		}
+		byRoute[t.RouteID][t.BlockID] = append(byRoute[t.RouteID][t.BlockID], t)
+	}
+
+	out := make(map[string]map[string]brigade, len(byRoute))
+	entityCount := 0
+	for routeID, blocks := range byRoute {
+		blockIDs := make([]string, 0, len(blocks))
+		for blockID := range blocks {
+			blockIDs = append(blockIDs, blockID)
+		}
+		sort.Strings(blockIDs)
+
+		route := make(map[string]brigade, len(blockIDs))
+		for i, blockID := range blockIDs {
+			trips := blocks[blockID]
+			tripIDs := make([]string, len(trips))
+			for j, t := range trips {
+				tripIDs[j] = t.ID
+			}
+
+			brigadeID := fmt.Sprintf("%d", i+1)
+			opts.logger().Debug("Matched brigade", "route", routeID, "brigade", brigadeID,
+				"block", blockID, "trips", len(tripIDs))
+			route[brigadeID] = brigade{Trips: tripIDs}
+			entityCount++
+		}
+		out[routeID] = route
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	if err := opts.Sink.Write(context.Background(), opts.JSONName, data); err != nil {
+		return err
+	}
+
+	if opts.Metrics != nil {
+		opts.Metrics.SetGauge("brigades_entity_count", float64(entityCount))
+		opts.Metrics.ObserveDuration("brigades_build_duration_seconds", time.Since(start))
+		opts.Metrics.MarkBuildSuccess(time.Now())
+	}
+	return nil
+}
+
+// incFetchErrors increments the fetch-errors-by-source counter, if opts.Metrics is set.
+func (opts Options) incFetchErrors(source string, delta float64) {
+	if opts.Metrics != nil {
+		opts.Metrics.IncCounter(`fetch_errors_total{source="`+source+`"}`, delta)
+	}
+}
+
+// Loop calls Main every interval, fetching the current GTFS from gtfsSrc
+// (which reloads it only when its underlying Resource reports new content).
+// gtfsSrc may be shared with other loops, e.g. by the "all" subcommand, so
+// the static GTFS is parsed at most once per change no matter how many
+// feeds are being generated.
+func Loop(client *http.Client, gtfsSrc *util.GtfsSupplier, interval time.Duration, opts Options) error {
+	for {
+		gtfsFile, err := gtfsSrc.Get()
+		if err != nil {
+			opts.incFetchErrors("GTFS mirror", 1)
+		} else {
+			err = Main(client, gtfsFile, opts)
+		}
+		if err != nil {
+			if opts.ThrowAPIErrors {
+				return err
+			}
+			opts.logger().Error("Error creating brigades.json", "error", err)
+		}
+
+		time.Sleep(interval)
+	}
+}
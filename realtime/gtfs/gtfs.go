@@ -0,0 +1,154 @@
+// Package gtfs parses the slice of the static Warsaw GTFS that the realtime
+// subsystem needs: routes, trips, stop_times and stops, loaded lazily from a zip
+// archive read either from disk or downloaded over HTTP.
+package gtfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// Gtfs is a parsed static GTFS feed. Tables are loaded on demand through
+// LoadRoutes/LoadStopTimes/LoadStops/LoadTrips (or all at once via LoadAll)
+// and left at their zero value otherwise.
+type Gtfs struct {
+	zip *zip.Reader
+
+	Routes    Routes
+	StopTimes StopTimesByTrip
+	Stops     Stops
+	Trips     Trips
+}
+
+// NewGtfsFromFile opens a local GTFS zip archive.
+func NewGtfsFromFile(path string) (*Gtfs, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newGtfsFromBytes(data)
+}
+
+// NewGtfsFromURL downloads a GTFS zip archive over HTTP(S).
+func NewGtfsFromURL(url string, client *http.Client) (*Gtfs, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return newGtfsFromBytes(data)
+}
+
+func newGtfsFromBytes(data []byte) (*Gtfs, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	return &Gtfs{zip: r}, nil
+}
+
+// GetZipFileByName reads a file out of the GTFS archive by name, or returns
+// nil if it isn't present.
+func (g *Gtfs) GetZipFileByName(name string) io.Reader {
+	for _, f := range g.zip.File {
+		if f.Name != name {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil
+		}
+		defer rc.Close()
+
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			return nil
+		}
+		return bytes.NewReader(data)
+	}
+	return nil
+}
+
+// LoadAll loads every GTFS table the realtime subsystem uses: routes.txt,
+// trips.txt, stop_times.txt and stops.txt. Tables missing from the archive
+// are silently left unloaded.
+func (g *Gtfs) LoadAll() error {
+	if f := g.GetZipFileByName("routes.txt"); f != nil {
+		if err := g.LoadRoutes(f); err != nil {
+			return err
+		}
+	}
+	if f := g.GetZipFileByName("trips.txt"); f != nil {
+		if err := g.LoadTrips(f); err != nil {
+			return err
+		}
+	}
+	if f := g.GetZipFileByName("stop_times.txt"); f != nil {
+		if err := g.LoadStopTimes(f); err != nil {
+			return err
+		}
+	}
+	if f := g.GetZipFileByName("stops.txt"); f != nil {
+		if err := g.LoadStops(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Route is the relevant field-set of a routes.txt row.
+type Route struct {
+	ID        string
+	ShortName string
+	Type      int
+}
+
+// Routes indexes routes.txt rows by route_id.
+type Routes map[string]Route
+
+// LoadRoutes parses routes.txt.
+func (g *Gtfs) LoadRoutes(f io.Reader) error {
+	r := csv.NewReader(f)
+
+	header, err := r.Read()
+	if err != nil {
+		return err
+	}
+	col := headerIndex(header)
+
+	g.Routes = make(Routes)
+
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		typ, err := strconv.Atoi(row[col["route_type"]])
+		if err != nil {
+			return err
+		}
+
+		id := row[col["route_id"]]
+		g.Routes[id] = Route{
+			ID:        id,
+			ShortName: row[col["route_short_name"]],
+			Type:      typ,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package gtfs
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// StopTime is a single relevant field-set of a stop_times.txt row.
+type StopTime struct {
+	StopID        string
+	StopSequence  int
+	ArrivalTime   string
+	DepartureTime string
+}
+
+// StopTimesByTrip indexes stop_times.txt rows by trip_id, in stop_sequence order.
+type StopTimesByTrip map[string][]StopTime
+
+// LoadStopTimes parses stop_times.txt and builds the per-trip index used by the
+// tripupdates package to interpolate delays between timed stops.
+func (g *Gtfs) LoadStopTimes(f io.Reader) error {
+	r := csv.NewReader(f)
+
+	header, err := r.Read()
+	if err != nil {
+		return err
+	}
+	col := headerIndex(header)
+
+	g.StopTimes = make(StopTimesByTrip)
+
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		seq, err := strconv.Atoi(row[col["stop_sequence"]])
+		if err != nil {
+			return err
+		}
+
+		tripID := row[col["trip_id"]]
+		g.StopTimes[tripID] = append(g.StopTimes[tripID], StopTime{
+			StopID:        row[col["stop_id"]],
+			StopSequence:  seq,
+			ArrivalTime:   row[col["arrival_time"]],
+			DepartureTime: row[col["departure_time"]],
+		})
+	}
+
+	for _, sts := range g.StopTimes {
+		sort.Slice(sts, func(i, j int) bool { return sts[i].StopSequence < sts[j].StopSequence })
+	}
+
+	return nil
+}
+
+// headerIndex maps GTFS CSV column names to their position in a row.
+func headerIndex(header []string) map[string]int {
+	idx := make(map[string]int, len(header))
+	for i, name := range header {
+		idx[name] = i
+	}
+	return idx
+}
@@ -0,0 +1,54 @@
+package gtfs
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// Stop is the relevant field-set of a stops.txt row.
+type Stop struct {
+	ID  string
+	Lat float64
+	Lon float64
+}
+
+// Stops indexes stops.txt rows by stop_id.
+type Stops map[string]Stop
+
+// LoadStops parses stops.txt. Used by tripupdates to find which of a trip's
+// timed stops a vehicle fix is physically nearest to.
+func (g *Gtfs) LoadStops(f io.Reader) error {
+	r := csv.NewReader(f)
+
+	header, err := r.Read()
+	if err != nil {
+		return err
+	}
+	col := headerIndex(header)
+
+	g.Stops = make(Stops)
+
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		lat, err := strconv.ParseFloat(row[col["stop_lat"]], 64)
+		if err != nil {
+			return err
+		}
+		lon, err := strconv.ParseFloat(row[col["stop_lon"]], 64)
+		if err != nil {
+			return err
+		}
+
+		id := row[col["stop_id"]]
+		g.Stops[id] = Stop{ID: id, Lat: lat, Lon: lon}
+	}
+
+	return nil
+}
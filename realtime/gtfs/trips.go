@@ -0,0 +1,48 @@
+package gtfs
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// Trip is the relevant field-set of a trips.txt row.
+type Trip struct {
+	ID      string
+	RouteID string
+	BlockID string
+}
+
+// Trips indexes trips.txt rows by trip_id.
+type Trips map[string]Trip
+
+// LoadTrips parses trips.txt. Used by brigades to group a route's trips by
+// block_id, i.e. by the physical vehicle that works them in sequence.
+func (g *Gtfs) LoadTrips(f io.Reader) error {
+	r := csv.NewReader(f)
+
+	header, err := r.Read()
+	if err != nil {
+		return err
+	}
+	col := headerIndex(header)
+
+	g.Trips = make(Trips)
+
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		id := row[col["trip_id"]]
+		g.Trips[id] = Trip{
+			ID:      id,
+			RouteID: row[col["route_id"]],
+			BlockID: row[col["block_id"]],
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+// Package metrics is a minimal Prometheus-text-format registry shared by the
+// alerts, brigades, positions and tripupdates loop modes, so operators can scrape
+// feed age, build durations and fetch errors without running a sidecar exporter.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Registry collects counters, gauges and histograms and serves them in the
+// Prometheus exposition format, plus a /healthz endpoint derived from the last
+// successful build timestamp.
+type Registry struct {
+	mu         sync.Mutex
+	counters   map[string]float64
+	gauges     map[string]float64
+	histograms map[string]*histogram
+	lastBuild  time.Time
+	staleAfter time.Duration
+}
+
+type histogram struct {
+	sum   float64
+	count uint64
+}
+
+// NewRegistry creates an empty Registry. staleAfter configures Healthz: it starts
+// failing once no build has succeeded for at least that long. A zero staleAfter
+// disables the staleness check.
+func NewRegistry(staleAfter time.Duration) *Registry {
+	return &Registry{
+		counters:   make(map[string]float64),
+		gauges:     make(map[string]float64),
+		histograms: make(map[string]*histogram),
+		staleAfter: staleAfter,
+	}
+}
+
+// IncCounter adds delta to the named counter, e.g. "fetch_errors_total{source=...}".
+func (r *Registry) IncCounter(name string, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters[name] += delta
+}
+
+// SetGauge sets the named gauge to value, e.g. "entity_count{feed=...}".
+func (r *Registry) SetGauge(name string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges[name] = value
+}
+
+// ObserveDuration records value into the named build-duration histogram.
+func (r *Registry) ObserveDuration(name string, value time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.histograms[name]
+	if !ok {
+		h = &histogram{}
+		r.histograms[name] = h
+	}
+	h.sum += value.Seconds()
+	h.count++
+}
+
+// MarkBuildSuccess records now as the last successful build time, read back by
+// the Healthz handler to decide whether the feed has gone stale.
+func (r *Registry) MarkBuildSuccess(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastBuild = now
+	r.gauges["last_successful_build_timestamp_seconds"] = float64(now.Unix())
+}
+
+// Handler serves every collected metric in the Prometheus text exposition format.
+func (r *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for name, v := range r.counters {
+			fmt.Fprintf(w, "warsawgtfs_rt_%s %v\n", name, v)
+		}
+		for name, v := range r.gauges {
+			fmt.Fprintf(w, "warsawgtfs_rt_%s %v\n", name, v)
+		}
+		for name, h := range r.histograms {
+			fmt.Fprintf(w, "warsawgtfs_rt_%s_sum %v\n", name, h.sum)
+			fmt.Fprintf(w, "warsawgtfs_rt_%s_count %v\n", name, h.count)
+		}
+	}
+}
+
+// HealthzHandler replies 200 if the last successful build is within staleAfter,
+// 503 otherwise (or if no build has ever succeeded).
+func (r *Registry) HealthzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		r.mu.Lock()
+		lastBuild := r.lastBuild
+		staleAfter := r.staleAfter
+		r.mu.Unlock()
+
+		if lastBuild.IsZero() || (staleAfter > 0 && time.Since(lastBuild) > staleAfter) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, "stale\n")
+			return
+		}
+		io.WriteString(w, "ok\n")
+	}
+}
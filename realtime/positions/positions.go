@@ -0,0 +1,237 @@
+// Package positions creates a GTFS-Realtime vehicle positions feed from live
+// AVL fixes retrieved from api.um.warszawa.pl, linked to scheduled trips via
+// brigades.json.
+package positions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/MKuranowski/WarsawGTFS/realtime/metrics"
+	"github.com/MKuranowski/WarsawGTFS/realtime/sink"
+)
+
+// Options controls the behavior of Main and Loop.
+type Options struct {
+	// Sink is where the generated feed files are published.
+	Sink sink.Sink
+
+	GtfsRtName    string
+	JSONName      string
+	HumanReadable bool
+	Apikey        string
+	Brigades      string
+
+	// Metrics, if set, receives build duration, entity count and fetch error
+	// instrumentation for this feed.
+	Metrics *metrics.Registry
+
+	// Logger receives structured progress and debug logs; defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// logger returns opts.Logger, falling back to slog.Default() if unset.
+func (opts Options) logger() *slog.Logger {
+	if opts.Logger != nil {
+		return opts.Logger
+	}
+	return slog.Default()
+}
+
+const positionsURL = "https://api.um.warszawa.pl/api/action/busestrams_get/"
+
+// fix is a single AVL snapshot of a vehicle, as returned by api.um.warszawa.pl.
+type fix struct {
+	Line    string  `json:"Lines"`
+	Brigade string  `json:"Brigade"`
+	Lat     float64 `json:"Lat"`
+	Lon     float64 `json:"Lon"`
+	Time    string  `json:"Time"`
+}
+
+// brigadeInfo is one brigade's scheduled trips, as found in brigades.json.
+type brigadeInfo struct {
+	Trips []string `json:"trips"`
+}
+
+// Main fetches one snapshot of vehicle positions, matches every fix to a
+// scheduled trip via brigades.json and writes a GTFS-Realtime
+// VehiclePositions feed to opts.GtfsRtName (and opts.JSONName, if set)
+// through opts.Sink.
+func Main(client *http.Client, opts Options) error {
+	start := time.Now()
+
+	brigadeMap, err := loadBrigades(client, opts.Brigades)
+	if err != nil {
+		opts.incFetchErrors("GTFS mirror", 1)
+		return err
+	}
+
+	fixes, err := fetchPositions(client, opts.Apikey)
+	if err != nil {
+		opts.incFetchErrors("api.um.warszawa.pl", 1)
+		return err
+	}
+
+	var kept []fix
+	var tripIDs []string
+	for _, f := range fixes {
+		info, ok := brigadeMap[f.Line+"/"+f.Brigade]
+		if !ok || len(info.Trips) == 0 {
+			opts.logger().Debug("Rejecting vehicle: no matching brigade",
+				"line", f.Line, "brigade", f.Brigade)
+			continue
+		}
+		kept = append(kept, f)
+		tripIDs = append(tripIDs, info.Trips[0])
+	}
+
+	if err := writeFeed(kept, tripIDs, opts); err != nil {
+		return err
+	}
+
+	if opts.Metrics != nil {
+		opts.Metrics.SetGauge("positions_entity_count", float64(len(kept)))
+		opts.Metrics.ObserveDuration("positions_build_duration_seconds", time.Since(start))
+		opts.Metrics.MarkBuildSuccess(time.Now())
+	}
+	return nil
+}
+
+// incFetchErrors increments the fetch-errors-by-source counter, if opts.Metrics is set.
+func (opts Options) incFetchErrors(source string, delta float64) {
+	if opts.Metrics != nil {
+		opts.Metrics.IncCounter(`fetch_errors_total{source="`+source+`"}`, delta)
+	}
+}
+
+// Loop calls Main every interval.
+func Loop(client *http.Client, interval time.Duration, opts Options) error {
+	for {
+		if err := Main(client, opts); err != nil {
+			opts.logger().Error("Error creating positions feed", "error", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// fetchPositions retrieves the current snapshot of all vehicle positions.
+func fetchPositions(client *http.Client, apikey string) ([]fix, error) {
+	q := url.Values{}
+	q.Set("resource_id", "f2e5503e-927d-4ad3-9500-4ab9e55deb59")
+	q.Set("apikey", apikey)
+	q.Set("type", "1")
+
+	resp, err := client.Get(positionsURL + "?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var payload struct {
+		Result []fix `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+	return payload.Result, nil
+}
+
+// loadBrigades fetches brigades.json (a local path or an http(s) URL) and
+// flattens its nested route->brigade structure into a map keyed by
+// "route/brigade" for lookup by Main.
+func loadBrigades(client *http.Client, path string) (map[string]brigadeInfo, error) {
+	raw, err := readBrigadesFile(client, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file map[string]map[string]brigadeInfo
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, err
+	}
+
+	flat := make(map[string]brigadeInfo)
+	for route, byBrigade := range file {
+		for brigadeID, info := range byBrigade {
+			flat[route+"/"+brigadeID] = info
+		}
+	}
+	return flat, nil
+}
+
+func readBrigadesFile(client *http.Client, path string) ([]byte, error) {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		resp, err := client.Get(path)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(resp.Body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	return os.ReadFile(path)
+}
+
+// writeFeed serializes the kept fixes as a GTFS-Realtime FeedMessage of
+// VehiclePosition entities and publishes it through opts.Sink.
+func writeFeed(fixes []fix, tripIDs []string, opts Options) error {
+	msg := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
+			GtfsRealtimeVersion: proto.String("2.0"),
+			Incrementality:      gtfsrt.FeedHeader_FULL_DATASET.Enum(),
+			Timestamp:           proto.Uint64(uint64(time.Now().Unix())),
+		},
+	}
+
+	for i, f := range fixes {
+		msg.Entity = append(msg.Entity, &gtfsrt.FeedEntity{
+			Id: proto.String(fmt.Sprintf("%s_%s", f.Line, f.Brigade)),
+			Vehicle: &gtfsrt.VehiclePosition{
+				Trip: &gtfsrt.TripDescriptor{TripId: proto.String(tripIDs[i])},
+				Position: &gtfsrt.Position{
+					Latitude:  proto.Float32(float32(f.Lat)),
+					Longitude: proto.Float32(float32(f.Lon)),
+				},
+			},
+		})
+	}
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if err := opts.Sink.Write(context.Background(), opts.GtfsRtName, data); err != nil {
+		return err
+	}
+
+	if opts.JSONName == "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if opts.HumanReadable {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(fixes); err != nil {
+		return err
+	}
+	return opts.Sink.Write(context.Background(), opts.JSONName, buf.Bytes())
+}
@@ -0,0 +1,104 @@
+// Package serve exposes the most recently generated feeds over HTTP, with
+// conditional-GET support (ETag/If-None-Match, Last-Modified/If-Modified-Since),
+// Cache-Control headers and optional Ed25519 signatures for downstream consumers
+// to verify authenticity.
+package serve
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// entry is one file kept in the in-memory buffer.
+type entry struct {
+	data    []byte
+	modTime time.Time
+	etag    string
+}
+
+// Store is an in-memory buffer of the latest generated feeds, swapped
+// atomically on each successful rebuild so HTTP clients never observe a
+// partially-written feed.
+type Store struct {
+	mu      sync.RWMutex
+	entries map[string]entry
+	signKey ed25519.PrivateKey
+}
+
+// NewStore creates an empty Store. signKey may be nil to disable signing.
+func NewStore(signKey ed25519.PrivateKey) *Store {
+	return &Store{entries: make(map[string]entry), signKey: signKey}
+}
+
+// Sink returns a sink.Sink that writes into this Store; combine it with a
+// persistent sink via sink.Multi to both publish and serve a feed.
+func (s *Store) Sink() *StoreSink {
+	return &StoreSink{store: s}
+}
+
+// StoreSink is the sink.Sink view of a Store.
+type StoreSink struct {
+	store *Store
+}
+
+// Write implements sink.Sink by buffering data (and its signature, if a
+// signing key was configured) in the Store, replacing any prior version.
+func (w *StoreSink) Write(_ context.Context, name string, data []byte) error {
+	w.store.put(name, data)
+	return nil
+}
+
+func (s *Store) put(name string, data []byte) {
+	sum := sha256.Sum256(data)
+	e := entry{data: data, modTime: time.Now(), etag: `"` + hex.EncodeToString(sum[:]) + `"`}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[name] = e
+	if s.signKey != nil {
+		sig := ed25519.Sign(s.signKey, data)
+		sigSum := sha256.Sum256(sig)
+		sigEtag := `"` + hex.EncodeToString(sigSum[:]) + `"`
+		s.entries[name+".sig"] = entry{data: sig, modTime: e.modTime, etag: sigEtag}
+	}
+}
+
+// Handler serves every buffered file with Last-Modified/ETag/Cache-Control
+// headers and honors If-None-Match/If-Modified-Since with 304 responses.
+func (s *Store) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+
+		s.mu.RLock()
+		e, ok := s.entries[name]
+		s.mu.RUnlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("ETag", e.etag)
+		w.Header().Set("Last-Modified", e.modTime.UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "no-cache")
+
+		if match := r.Header.Get("If-None-Match"); match != "" && match == e.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if since := r.Header.Get("If-Modified-Since"); since != "" {
+			if t, err := http.ParseTime(since); err == nil && !e.modTime.Truncate(time.Second).After(t) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+
+		w.Write(e.data)
+	}
+}
@@ -0,0 +1,43 @@
+package sink
+
+import (
+	"context"
+
+	"cloud.google.com/go/storage"
+)
+
+// GCS publishes feeds to a Google Cloud Storage bucket, under an optional
+// object-name prefix. Uploads are atomic by construction: the object is only
+// committed once the writer is closed without error.
+type GCS struct {
+	client *storage.Client
+	bucket string
+	prefix string
+}
+
+// newGCS builds a GCS sink from the "bucket/prefix" part of a gs:// target,
+// using application-default credentials.
+func newGCS(target string) (*GCS, error) {
+	bucket, prefix := splitBucketPrefix(target)
+
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &GCS{client: client, bucket: bucket, prefix: prefix}, nil
+}
+
+// Write implements Sink.
+func (g *GCS) Write(ctx context.Context, name string, data []byte) error {
+	key := name
+	if g.prefix != "" {
+		key = g.prefix + "/" + name
+	}
+
+	w := g.client.Bucket(g.bucket).Object(key).NewWriter(ctx)
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,18 @@
+package sink
+
+import "context"
+
+// Multi fans a single write out to every given Sink, e.g. so a feed can be both
+// persisted to object storage and kept in an in-memory buffer for low-latency
+// HTTP serving.
+type Multi []Sink
+
+// Write implements Sink.
+func (m Multi) Write(ctx context.Context, name string, data []byte) error {
+	for _, s := range m {
+		if err := s.Write(ctx, name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3 publishes feeds to an S3 bucket, under an optional key prefix. Uploads
+// are atomic by construction: an object only becomes visible once PutObject
+// fully succeeds.
+type S3 struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// newS3 builds an S3 sink from the "bucket/prefix" part of an s3:// target,
+// using the default AWS credential chain.
+func newS3(target string) (*S3, error) {
+	bucket, prefix := splitBucketPrefix(target)
+
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &S3{client: s3.NewFromConfig(cfg), bucket: bucket, prefix: prefix}, nil
+}
+
+// Write implements Sink.
+func (s *S3) Write(ctx context.Context, name string, data []byte) error {
+	key := name
+	if s.prefix != "" {
+		key = s.prefix + "/" + name
+	}
+
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
@@ -0,0 +1,69 @@
+// Package sink provides pluggable publish destinations for generated
+// GTFS-Realtime and JSON feeds: local files, S3, GCS and WebDAV, selected by
+// the scheme of a -target string.
+package sink
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Sink is a destination that a generated feed file is published to.
+type Sink interface {
+	// Write publishes name with the given contents. Implementations publish
+	// atomically where the backing store allows it, so readers never observe
+	// a partially-written file under its final name.
+	Write(ctx context.Context, name string, data []byte) error
+}
+
+// New parses a -target string's scheme and returns the matching Sink:
+//   - "s3://bucket/prefix"    -> S3
+//   - "gs://bucket/prefix"    -> GCS
+//   - "webdav://host/path"    -> WebDAV
+//   - anything else           -> Local, rooted at that directory
+func New(target string) (Sink, error) {
+	switch {
+	case strings.HasPrefix(target, "s3://"):
+		return newS3(strings.TrimPrefix(target, "s3://"))
+	case strings.HasPrefix(target, "gs://"):
+		return newGCS(strings.TrimPrefix(target, "gs://"))
+	case strings.HasPrefix(target, "webdav://"):
+		return newWebDAV(strings.TrimPrefix(target, "webdav://"))
+	default:
+		return &Local{Dir: target}, nil
+	}
+}
+
+// Local writes files directly to a directory on the local filesystem. It
+// publishes atomically by writing to a temporary file and renaming it into
+// place, which is atomic on any single filesystem.
+type Local struct {
+	Dir string
+}
+
+// Write implements Sink.
+func (l *Local) Write(_ context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(l.Dir, 0o755); err != nil {
+		return err
+	}
+
+	final := filepath.Join(l.Dir, name)
+	tmp := final + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, final)
+}
+
+// splitBucketPrefix splits the "bucket/prefix" part of an s3:// or gs:// target.
+func splitBucketPrefix(target string) (bucket, prefix string) {
+	parts := strings.SplitN(target, "/", 2)
+	bucket = parts[0]
+	if len(parts) == 2 {
+		prefix = parts[1]
+	}
+	return
+}
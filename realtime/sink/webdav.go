@@ -0,0 +1,70 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// WebDAV publishes feeds to a WebDAV server by PUTting to a temporary
+// resource and then issuing a MOVE, so partial uploads never become visible
+// under the final name.
+type WebDAV struct {
+	client  *http.Client
+	baseURL string
+}
+
+// newWebDAV builds a WebDAV sink from the "host/path" part of a webdav:// target.
+func newWebDAV(target string) (*WebDAV, error) {
+	return &WebDAV{client: &http.Client{}, baseURL: "https://" + target}, nil
+}
+
+// Write implements Sink.
+func (w *WebDAV) Write(ctx context.Context, name string, data []byte) error {
+	tmpURL := w.baseURL + "/" + name + ".tmp"
+	finalURL := w.baseURL + "/" + name
+
+	if err := w.put(ctx, tmpURL, data); err != nil {
+		return err
+	}
+	return w.move(ctx, tmpURL, finalURL)
+}
+
+func (w *WebDAV) put(ctx context.Context, url string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webdav PUT %s: status %s", url, resp.Status)
+	}
+	return nil
+}
+
+func (w *WebDAV) move(ctx context.Context, from, to string) error {
+	req, err := http.NewRequestWithContext(ctx, "MOVE", from, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Destination", to)
+	req.Header.Set("Overwrite", "T")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webdav MOVE %s: status %s", from, resp.Status)
+	}
+	return nil
+}
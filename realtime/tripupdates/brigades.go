@@ -0,0 +1,57 @@
+package tripupdates
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// brigade is one brigade's scheduled trips for the day, as produced by the
+// brigades package's nested route->brigade->trips structure.
+type brigade struct {
+	Trips []string `json:"trips"`
+}
+
+// loadBrigades fetches brigades.json (a local path or an http(s) URL, as
+// -brigades-file defaults to the latter) and flattens its nested
+// route->brigade structure into a map keyed by "route/brigade" for lookup by
+// buildFeed.
+func loadBrigades(client *http.Client, path string) (map[string]brigade, error) {
+	raw, err := readBrigadesFile(client, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file map[string]map[string]brigade
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, err
+	}
+
+	flat := make(map[string]brigade)
+	for route, byBrigade := range file {
+		for brigadeID, info := range byBrigade {
+			flat[route+"/"+brigadeID] = info
+		}
+	}
+	return flat, nil
+}
+
+func readBrigadesFile(client *http.Client, path string) ([]byte, error) {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		resp, err := client.Get(path)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(resp.Body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	return os.ReadFile(path)
+}
@@ -0,0 +1,5 @@
+package tripupdates
+
+import "errors"
+
+var errNoStopTimes = errors.New("no file stop_times.txt in the GTFS")
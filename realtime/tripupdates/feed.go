@@ -0,0 +1,261 @@
+package tripupdates
+
+import (
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MKuranowski/WarsawGTFS/realtime/gtfs"
+)
+
+// update is a single stop-level delay prediction for a trip.
+type update struct {
+	TripID       string
+	StopID       string
+	StopSequence int
+	DelaySeconds int
+}
+
+// feed is the set of trip updates produced from one AVL snapshot.
+type feed struct {
+	Updates []update
+}
+
+// buildFeed matches every AVL fix to the brigade's trip actually running at
+// the fix's reported time, estimates the fix's delay by linear interpolation
+// between the two scheduled stops its Lat/Lon falls closest to, and carries
+// that delay forward to the next stop not yet reached and every stop still
+// ahead of it, per GTFS-Realtime's usual delay-propagation semantics.
+func buildFeed(gtfsFile *gtfs.Gtfs, fixes []fix, brigades map[string]brigade, logger *slog.Logger) feed {
+	var f feed
+
+	for _, vehicle := range fixes {
+		b, ok := brigades[vehicle.Line+"/"+vehicle.Brigade]
+		if !ok || len(b.Trips) == 0 {
+			logger.Debug("Rejecting vehicle: no matching brigade",
+				"line", vehicle.Line, "brigade", vehicle.Brigade)
+			continue
+		}
+
+		actualSeconds, err := parseTimeOfDay(vehicle.Time)
+		if err != nil {
+			logger.Debug("Rejecting vehicle: unparseable AVL timestamp",
+				"line", vehicle.Line, "brigade", vehicle.Brigade, "time", vehicle.Time)
+			continue
+		}
+
+		tripID, stopTimes, actual, ok := selectActiveTrip(gtfsFile.StopTimes, b.Trips, actualSeconds)
+		if !ok {
+			logger.Debug("Rejecting vehicle: no scheduled trip among brigade's trips",
+				"line", vehicle.Line, "brigade", vehicle.Brigade)
+			continue
+		}
+
+		delay, cutoff, ok := estimateDelay(gtfsFile.Stops, stopTimes, vehicle, actual)
+		if !ok {
+			logger.Debug("Rejecting vehicle: could not estimate delay",
+				"line", vehicle.Line, "brigade", vehicle.Brigade, "trip_id", tripID)
+			continue
+		}
+
+		for _, st := range stopTimes[cutoff:] {
+			f.Updates = append(f.Updates, update{
+				TripID:       tripID,
+				StopID:       st.StopID,
+				StopSequence: st.StopSequence,
+				DelaySeconds: delay,
+			})
+		}
+	}
+
+	return f
+}
+
+// selectActiveTrip picks the trip, among tripIDs, that's scheduled to be
+// running at actualSeconds (the vehicle's current time-of-day): the one
+// whose first-to-last scheduled arrival span is closest to (or contains)
+// actualSeconds. A trip's span may run past 86400s, GTFS's usual convention
+// for night service that starts before and ends after midnight, so
+// actualSeconds is also tried rolled forward by 24h to match those. Returns
+// the matched trip's ID and stopTimes, plus whichever of actualSeconds or
+// actualSeconds+86400 was used to match it, for estimateDelay to reuse.
+func selectActiveTrip(stopTimes gtfs.StopTimesByTrip, tripIDs []string, actualSeconds int) (tripID string, trip []gtfs.StopTime, actual int, ok bool) {
+	bestDist := math.MaxInt64
+
+	for _, candidateID := range tripIDs {
+		candidate := stopTimes[candidateID]
+		if len(candidate) == 0 {
+			continue
+		}
+
+		start, err := parseGtfsTime(candidate[0].ArrivalTime)
+		if err != nil {
+			continue
+		}
+		end, err := parseGtfsTime(candidate[len(candidate)-1].ArrivalTime)
+		if err != nil {
+			continue
+		}
+
+		for _, a := range [2]int{actualSeconds, actualSeconds + 86400} {
+			if dist := spanDistance(a, start, end); dist < bestDist {
+				bestDist, tripID, trip, actual, ok = dist, candidateID, candidate, a, true
+			}
+		}
+	}
+
+	return
+}
+
+// spanDistance returns how far actual falls outside [start, end], or 0 if
+// it's within the span.
+func spanDistance(actual, start, end int) int {
+	switch {
+	case actual < start:
+		return start - actual
+	case actual > end:
+		return actual - end
+	default:
+		return 0
+	}
+}
+
+// estimateDelay finds the pair of consecutive timed stops in stopTimes whose
+// path vehicle's reported Lat/Lon falls closest to, linearly interpolates
+// the scheduled time at that position, and compares it against actual (the
+// vehicle's current time-of-day, already rolled onto the same service day as
+// stopTimes by selectActiveTrip). cutoff is the index of the first stop not
+// yet reached, i.e. the first stop buildFeed should still emit an update for.
+func estimateDelay(stops gtfs.Stops, stopTimes []gtfs.StopTime, vehicle fix, actual int) (delay, cutoff int, ok bool) {
+	if len(stopTimes) == 1 {
+		scheduled, err := parseGtfsTime(stopTimes[0].ArrivalTime)
+		if err != nil {
+			return 0, 0, false
+		}
+		return actual - scheduled, 0, true
+	}
+
+	seg, frac := nearestSegment(stops, stopTimes, vehicle)
+
+	start, err := parseGtfsTime(stopTimes[seg].ArrivalTime)
+	if err != nil {
+		return 0, 0, false
+	}
+	end, err := parseGtfsTime(stopTimes[seg+1].ArrivalTime)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	scheduled := start + int(frac*float64(end-start))
+	cutoff = seg
+	if frac > 0 {
+		cutoff = seg + 1
+	}
+	return actual - scheduled, cutoff, true
+}
+
+// nearestSegment returns the index i of the scheduled-stop segment
+// [stopTimes[i], stopTimes[i+1]] that vehicle's reported Lat/Lon projects
+// closest onto, along with how far along that segment (0..1) it projects. If
+// stop coordinates aren't loaded, it falls back to the first segment.
+func nearestSegment(stops gtfs.Stops, stopTimes []gtfs.StopTime, vehicle fix) (int, float64) {
+	if stops == nil {
+		return 0, 0
+	}
+
+	best := 0
+	bestFrac := 0.0
+	bestDist := math.Inf(1)
+
+	for i := 0; i < len(stopTimes)-1; i++ {
+		a, ok1 := stops[stopTimes[i].StopID]
+		b, ok2 := stops[stopTimes[i+1].StopID]
+		if !ok1 || !ok2 {
+			continue
+		}
+
+		frac := projectFraction(a, b, vehicle)
+		lat := a.Lat + frac*(b.Lat-a.Lat)
+		lon := a.Lon + frac*(b.Lon-a.Lon)
+
+		if d := haversine(vehicle.Lat, vehicle.Lon, lat, lon); d < bestDist {
+			best, bestFrac, bestDist = i, frac, d
+		}
+	}
+
+	return best, bestFrac
+}
+
+// projectFraction returns where, along the straight line from a to b, the
+// point nearest to vehicle falls, clamped to the [0, 1] segment.
+func projectFraction(a, b gtfs.Stop, vehicle fix) float64 {
+	abLat, abLon := b.Lat-a.Lat, b.Lon-a.Lon
+	denom := abLat*abLat + abLon*abLon
+	if denom == 0 {
+		return 0
+	}
+
+	avLat, avLon := vehicle.Lat-a.Lat, vehicle.Lon-a.Lon
+	t := (avLat*abLat + avLon*abLon) / denom
+
+	switch {
+	case t < 0:
+		return 0
+	case t > 1:
+		return 1
+	default:
+		return t
+	}
+}
+
+// haversine returns the great-circle distance between two coordinates, in meters.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusMeters = 6371000.0
+
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(lat2 - lat1)
+	dLon := rad(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return earthRadiusMeters * c
+}
+
+// parseGtfsTime parses a GTFS HH:MM:SS timestamp (hours may exceed 24) into seconds
+// since midnight of the service day.
+func parseGtfsTime(s string) (int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, strconv.ErrSyntax
+	}
+
+	h, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, err
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, err
+	}
+	sec, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, err
+	}
+
+	return h*3600 + m*60 + sec, nil
+}
+
+// parseTimeOfDay parses the api.um.warszawa.pl "YYYY-MM-DD HH:MM:SS" vehicle
+// timestamp into seconds since midnight of that day.
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("2006-01-02 15:04:05", s)
+	if err != nil {
+		return 0, err
+	}
+
+	h, m, sec := t.Clock()
+	return h*3600 + m*60 + sec, nil
+}
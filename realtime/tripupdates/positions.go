@@ -0,0 +1,46 @@
+package tripupdates
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// positionsURL is the same api.um.warszawa.pl endpoint used by the positions package.
+const positionsURL = "https://api.um.warszawa.pl/api/action/busestrams_get/"
+
+// fix is a single AVL snapshot of a vehicle, as returned by api.um.warszawa.pl.
+type fix struct {
+	Line    string  `json:"Lines"`
+	Brigade string  `json:"Brigade"`
+	Lat     float64 `json:"Lat"`
+	Lon     float64 `json:"Lon"`
+	Time    string  `json:"Time"`
+}
+
+// fetchPositions retrieves the current snapshot of all vehicle positions.
+func fetchPositions(client *http.Client, apikey string) ([]fix, error) {
+	q := url.Values{}
+	q.Set("resource_id", "f2e5503e-927d-4ad3-9500-4ab9e55deb59")
+	q.Set("apikey", apikey)
+	q.Set("type", "1")
+
+	resp, err := client.Get(positionsURL + "?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var payload struct {
+		Result []fix `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+	if payload.Result == nil {
+		return nil, errors.New("api.um.warszawa.pl returned no vehicle positions")
+	}
+
+	return payload.Result, nil
+}
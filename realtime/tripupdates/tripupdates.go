@@ -0,0 +1,107 @@
+// Package tripupdates creates a GTFS-Realtime TripUpdates feed by correlating live
+// vehicle positions from api.um.warszawa.pl with the static GTFS schedule.
+package tripupdates
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/MKuranowski/WarsawGTFS/realtime/gtfs"
+	"github.com/MKuranowski/WarsawGTFS/realtime/metrics"
+	"github.com/MKuranowski/WarsawGTFS/realtime/sink"
+	"github.com/MKuranowski/WarsawGTFS/realtime/util"
+)
+
+// Options controls the behavior of Main and Loop.
+type Options struct {
+	// Sink is where the generated feed files are published.
+	Sink sink.Sink
+
+	GtfsRtName    string
+	JSONName      string
+	HumanReadable bool
+	Apikey        string
+	Brigades      string
+
+	// Metrics, if set, receives build duration, entity count and fetch error
+	// instrumentation for this feed.
+	Metrics *metrics.Registry
+
+	// Logger receives structured progress and debug logs; defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// logger returns opts.Logger, falling back to slog.Default() if unset.
+func (opts Options) logger() *slog.Logger {
+	if opts.Logger != nil {
+		return opts.Logger
+	}
+	return slog.Default()
+}
+
+// Main fetches one snapshot of vehicle positions, matches every fix to the
+// brigade trip actually running at that time via brigades.json, estimates
+// each fix's delay by linear interpolation between its nearest two timed
+// stops, and writes a single TripUpdates feed to opts.GtfsRtName (and
+// opts.JSONName, if set) through opts.Sink.
+func Main(client *http.Client, gtfsFile *gtfs.Gtfs, opts Options) error {
+	start := time.Now()
+
+	brigades, err := loadBrigades(client, opts.Brigades)
+	if err != nil {
+		opts.incFetchErrors("GTFS mirror", 1)
+		return err
+	}
+
+	fixes, err := fetchPositions(client, opts.Apikey)
+	if err != nil {
+		opts.incFetchErrors("api.um.warszawa.pl", 1)
+		return err
+	}
+
+	feed := buildFeed(gtfsFile, fixes, brigades, opts.logger())
+	if err := writeFeed(feed, opts); err != nil {
+		return err
+	}
+
+	if opts.Metrics != nil {
+		opts.Metrics.SetGauge("trip_updates_entity_count", float64(len(feed.Updates)))
+		opts.Metrics.ObserveDuration("trip_updates_build_duration_seconds", time.Since(start))
+		opts.Metrics.MarkBuildSuccess(time.Now())
+	}
+	return nil
+}
+
+// incFetchErrors increments the fetch-errors-by-source counter, if opts.Metrics is set.
+func (opts Options) incFetchErrors(source string, delta float64) {
+	if opts.Metrics != nil {
+		opts.Metrics.IncCounter("fetch_errors_total{source=\""+source+"\"}", delta)
+	}
+}
+
+// Loop calls Main every interval, fetching the current GTFS from gtfsSrc
+// (which reloads it only when its underlying Resource reports new content).
+// gtfsSrc may be shared with other loops, e.g. by the "all" subcommand, so
+// the static GTFS is parsed at most once per change no matter how many
+// feeds are being generated.
+func Loop(client *http.Client, gtfsSrc *util.GtfsSupplier, interval time.Duration, opts Options) error {
+	for {
+		gtfsFile, err := gtfsSrc.Get()
+		if err != nil {
+			opts.incFetchErrors("GTFS mirror", 1)
+			opts.logger().Error("Error reloading GTFS for trip updates", "error", err)
+			time.Sleep(interval)
+			continue
+		}
+		if gtfsFile.StopTimes == nil {
+			return errNoStopTimes
+		}
+
+		if err := Main(client, gtfsFile, opts); err != nil {
+			opts.logger().Error("Error creating trip updates feed", "error", err)
+		}
+
+		time.Sleep(interval)
+	}
+}
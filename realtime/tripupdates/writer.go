@@ -0,0 +1,86 @@
+package tripupdates
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// writeFeed serializes feed as a GTFS-Realtime FeedMessage of TripUpdate
+// entities and publishes it through opts.Sink as opts.GtfsRtName (and
+// opts.JSONName, if set).
+func writeFeed(f feed, opts Options) error {
+	data, err := marshalFeedMessage(f)
+	if err != nil {
+		return err
+	}
+	if err := opts.Sink.Write(context.Background(), opts.GtfsRtName, data); err != nil {
+		return err
+	}
+
+	if opts.JSONName == "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if opts.HumanReadable {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(f.Updates); err != nil {
+		return err
+	}
+
+	return opts.Sink.Write(context.Background(), opts.JSONName, buf.Bytes())
+}
+
+// marshalFeedMessage groups f.Updates by trip and builds one TripUpdate
+// FeedEntity per trip, in the order its stops were appended.
+func marshalFeedMessage(f feed) ([]byte, error) {
+	msg := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
+			GtfsRealtimeVersion: proto.String("2.0"),
+			Incrementality:      gtfsrt.FeedHeader_FULL_DATASET.Enum(),
+			Timestamp:           proto.Uint64(uint64(time.Now().Unix())),
+		},
+	}
+
+	order := make([]string, 0)
+	byTrip := make(map[string][]update)
+	for _, u := range f.Updates {
+		if _, seen := byTrip[u.TripID]; !seen {
+			order = append(order, u.TripID)
+		}
+		byTrip[u.TripID] = append(byTrip[u.TripID], u)
+	}
+
+	for i, tripID := range order {
+		updates := byTrip[tripID]
+
+		stopTimeUpdates := make([]*gtfsrt.TripUpdate_StopTimeUpdate, len(updates))
+		for j, u := range updates {
+			delay := int32(u.DelaySeconds)
+			stopTimeUpdates[j] = &gtfsrt.TripUpdate_StopTimeUpdate{
+				StopSequence: proto.Uint32(uint32(u.StopSequence)),
+				StopId:       proto.String(u.StopID),
+				Arrival:      &gtfsrt.TripUpdate_StopTimeEvent{Delay: proto.Int32(delay)},
+				Departure:    &gtfsrt.TripUpdate_StopTimeEvent{Delay: proto.Int32(delay)},
+			}
+		}
+
+		msg.Entity = append(msg.Entity, &gtfsrt.FeedEntity{
+			Id: proto.String(fmt.Sprintf("trip_update_%d", i)),
+			TripUpdate: &gtfsrt.TripUpdate{
+				Trip:           &gtfsrt.TripDescriptor{TripId: proto.String(tripID)},
+				StopTimeUpdate: stopTimeUpdates,
+			},
+		})
+	}
+
+	return proto.Marshal(msg)
+}
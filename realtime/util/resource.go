@@ -0,0 +1,139 @@
+// Package util provides shared helpers for the realtime subsystem, chiefly
+// the Resource abstraction used to hot-reload the static GTFS in loop mode.
+package util
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MKuranowski/WarsawGTFS/realtime/gtfs"
+)
+
+// Resource is a static GTFS source that can report whether its content has
+// changed since the previous call, so loop mode only re-parses the GTFS when
+// it actually needs to.
+type Resource interface {
+	// Get returns the resource's current source (a path or URL, suitable for
+	// gtfs.NewGtfsFromFile/NewGtfsFromURL) along with whether its content has
+	// changed since the previous call. The very first call always reports
+	// changed.
+	Get() (source string, changed bool, err error)
+}
+
+// ResourceHTTP polls a URL's ETag/Last-Modified headers every Peroid to
+// detect changes without re-downloading the whole GTFS on every check.
+type ResourceHTTP struct {
+	Client *http.Client
+	URL    string
+	Peroid time.Duration
+
+	checked time.Time
+	seen    bool
+	tag     string
+}
+
+// Get implements Resource.
+func (r *ResourceHTTP) Get() (string, bool, error) {
+	if r.seen && time.Since(r.checked) < r.Peroid {
+		return r.URL, false, nil
+	}
+	r.checked = time.Now()
+
+	resp, err := r.Client.Head(r.URL)
+	if err != nil {
+		return "", false, err
+	}
+	resp.Body.Close()
+
+	tag := resp.Header.Get("ETag")
+	if tag == "" {
+		tag = resp.Header.Get("Last-Modified")
+	}
+
+	changed := !r.seen || tag == "" || tag != r.tag
+	r.seen = true
+	r.tag = tag
+	return r.URL, changed, nil
+}
+
+// ResourceLocal polls a local file's modification time every Peroid.
+type ResourceLocal struct {
+	Path   string
+	Peroid time.Duration
+
+	checked time.Time
+	seen    bool
+	modTime time.Time
+}
+
+// Get implements Resource.
+func (r *ResourceLocal) Get() (string, bool, error) {
+	if r.seen && time.Since(r.checked) < r.Peroid {
+		return r.Path, false, nil
+	}
+	r.checked = time.Now()
+
+	info, err := os.Stat(r.Path)
+	if err != nil {
+		return "", false, err
+	}
+
+	changed := !r.seen || info.ModTime().After(r.modTime)
+	r.seen = true
+	r.modTime = info.ModTime()
+	return r.Path, changed, nil
+}
+
+// GtfsSupplier hot-reloads a single *gtfs.Gtfs from a Resource and is safe
+// for concurrent use, so several independent loops (as the "all" subcommand
+// runs) can share one parse of the static GTFS instead of each polling the
+// same Resource and re-fetching it themselves.
+type GtfsSupplier struct {
+	Client   *http.Client
+	Resource Resource
+
+	// Logger, if set, receives a message every time the GTFS is reloaded.
+	Logger *slog.Logger
+
+	mu      sync.Mutex
+	current *gtfs.Gtfs
+}
+
+// Get returns the current *gtfs.Gtfs, loading every table it contains on the
+// first call and reloading it whenever Resource reports changed content.
+func (s *GtfsSupplier) Get() (*gtfs.Gtfs, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	source, changed, err := s.Resource.Get()
+	if err != nil {
+		return nil, err
+	}
+	if !changed && s.current != nil {
+		return s.current, nil
+	}
+
+	if s.Logger != nil {
+		s.Logger.Info("Reloading static GTFS", "source", source)
+	}
+
+	var gtfsFile *gtfs.Gtfs
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		gtfsFile, err = gtfs.NewGtfsFromURL(source, s.Client)
+	} else {
+		gtfsFile, err = gtfs.NewGtfsFromFile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := gtfsFile.LoadAll(); err != nil {
+		return nil, err
+	}
+
+	s.current = gtfsFile
+	return s.current, nil
+}
@@ -1,268 +1,643 @@
 package main
 
 import (
+	"crypto/ed25519"
 	"errors"
-	"flag"
-	"log"
+	"log/slog"
 	"net/http"
-	"path"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+
 	"github.com/MKuranowski/WarsawGTFS/realtime/alerts"
 	"github.com/MKuranowski/WarsawGTFS/realtime/brigades"
 	"github.com/MKuranowski/WarsawGTFS/realtime/gtfs"
+	"github.com/MKuranowski/WarsawGTFS/realtime/metrics"
 	"github.com/MKuranowski/WarsawGTFS/realtime/positions"
+	"github.com/MKuranowski/WarsawGTFS/realtime/serve"
+	"github.com/MKuranowski/WarsawGTFS/realtime/sink"
+	"github.com/MKuranowski/WarsawGTFS/realtime/tripupdates"
 	"github.com/MKuranowski/WarsawGTFS/realtime/util"
 )
 
-// Default CLI flags
-var (
-	// Mode selection
-	flagAlerts = flag.Bool(
-		"a",
-		false,
-		"create GTFS-Realtime alerts")
-
-	flagBrigades = flag.Bool(
-		"b",
-		false,
-		"create brigades.json (required for positions)")
-
-	flagPostions = flag.Bool(
-		"p",
-		false,
-		"create GTFS-Realtime vehicle positions")
-
-	// Input options
-	flagApikey = flag.String(
-		"k",
-		"",
-		"apikey for api.um.warszawa.pl (for brigades and positions)")
-
-	flagGtfsFile = flag.String(
-		"gtfs-file",
-		"https://mkuran.pl/gtfs/warsaw.zip",
-		"path/URL to static Warsaw GTFS (for alerts and brigades)")
-
-	flagBrigadesFile = flag.String(
-		"brigades-file",
-		"https://mkuran.pl/gtfs/warsaw/brigades.json",
-		"path/URL to file brigades.json (for positions)")
-
-	// Output options
-	flagTarget = flag.String(
-		"target",
-		"data_rt",
-		"target folder where to put created GTFS-Realtime files")
-
-	flagJSON = flag.Bool(
-		"json",
-		false,
-		"also save JSON files alongside GTFS-Relatime feeds")
-
-	flagReadable = flag.Bool(
-		"readable",
-		false,
-		"use a human-readable format for GTFS-Realtime target instead of a binary format")
-
-	flagStrict = flag.Bool(
-		"strict",
-		false,
-		"for alerts: any errors when scraping wtp.waw.pl will become fatal,\n"+
-			"for brigades: any ignorable data mismatch will become fatal")
-
-	// Loop options
-	flagLoop = flag.Duration(
-		"loop",
-		time.Duration(0),
-		"alerts/positions: instead of running once and exiting, "+
-			"update the output file every given duration\n"+
-			"brigades: if non-zero, update the brigades file every time -gtfs-file changes")
-
-	flagDataCheck = flag.Duration(
-		"checkdata",
-		time.Duration(30*60*1_000_000_000), // 30 minutes in ns
-		"alerts/brigades: how often check if the -gtfs-file has changed,\n"+
-			"positions: how often check if the -brigades-file has changed")
-)
-
-// Other global objects
-var gtfsFile *gtfs.Gtfs
 var client = &http.Client{}
 
-// checkModes ensures exactly one of flagAlerts, flagBrigades or flagPositions is set
-func checkModes() error {
-	var modeCount uint8
+// logger is the process-wide structured logger, configured by setupLogging
+// from the -log-level/-log-format flags before any command runs.
+var logger = slog.Default()
 
-	if *flagAlerts {
-		modeCount++
+func main() {
+	app := &cli.App{
+		Name:   "warsawgtfs-rt",
+		Usage:  "generate GTFS-Realtime feeds for Warsaw's public transport",
+		Flags:  logFlags(),
+		Before: setupLogging,
+		Commands: []*cli.Command{
+			alertsCommand(),
+			brigadesCommand(),
+			positionsCommand(),
+			tripUpdatesCommand(),
+			allCommand(),
+			generateKeyCommand(),
+		},
 	}
-	if *flagBrigades {
-		modeCount++
+
+	if err := app.Run(os.Args); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
-	if *flagPostions {
-		modeCount++
+}
+
+// logFlags are the app-level flags controlling the process-wide logger
+func logFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "log-level",
+			Value: "info",
+			Usage: "minimum level to log: debug, info, warn or error",
+		},
+		&cli.StringFlag{
+			Name:  "log-format",
+			Value: "text",
+			Usage: "log output format: text or json",
+		},
 	}
+}
 
-	if modeCount != 1 {
-		return errors.New("exactly one of the -a, -b or -p flags has to be provided")
+// setupLogging builds the process-wide logger from -log-level/-log-format and
+// installs it as the slog default, so library code logging through
+// slog.Default() (and any command that hasn't been handed an explicit Logger)
+// picks it up too.
+func setupLogging(ctx *cli.Context) error {
+	var level slog.Level
+	switch ctx.String("log-level") {
+	case "debug":
+		level = slog.LevelDebug
+	case "info":
+		level = slog.LevelInfo
+	case "warn":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	default:
+		return errors.New("invalid -log-level: " + ctx.String("log-level"))
 	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch ctx.String("log-format") {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, handlerOpts)
+	default:
+		return errors.New("invalid -log-format: " + ctx.String("log-format"))
+	}
+
+	logger = slog.New(handler)
+	slog.SetDefault(logger)
 	return nil
 }
 
-// loadGtfs creates a gtfs file from the provided argument and loads required data structures
-func loadGtfs() (err error) {
-	// retrieve the GTFS
-	log.Println("Retrieving provided GTFS")
-	if strings.HasPrefix(*flagGtfsFile, "http://") || strings.HasPrefix(*flagGtfsFile, "https://") {
-		gtfsFile, err = gtfs.NewGtfsFromURL(*flagGtfsFile, client)
-	} else {
-		gtfsFile, err = gtfs.NewGtfsFromFile(*flagGtfsFile)
+// concatFlags flattens several flag groups into one slice
+func concatFlags(groups ...[]cli.Flag) []cli.Flag {
+	var flags []cli.Flag
+	for _, g := range groups {
+		flags = append(flags, g...)
+	}
+	return flags
+}
+
+// withConfig wraps flags so their defaults can be overridden by -config
+func withConfig(flags []cli.Flag) []cli.Flag {
+	wrapped := make([]cli.Flag, len(flags))
+	for i, f := range flags {
+		wrapped[i] = altsrc.NewFlagFromFlag(f)
+	}
+	return wrapped
+}
+
+// before loads flag defaults from the YAML file passed via -config, if any
+func before(ctx *cli.Context) error {
+	if ctx.String("config") == "" {
+		return nil
+	}
+	return altsrc.InitInputSourceWithContext(
+		ctx.Command.Flags,
+		altsrc.NewYamlSourceFromFlagFunc("config"),
+	)(ctx)
+}
+
+// command builds a cli.Command with the shared -config flag and altsrc wiring
+func command(name, usage string, flags []cli.Flag, action cli.ActionFunc) *cli.Command {
+	allFlags := append([]cli.Flag{
+		&cli.StringFlag{Name: "config", Usage: "path to a YAML file with flag defaults"},
+	}, withConfig(flags)...)
+
+	return &cli.Command{
+		Name:   name,
+		Usage:  usage,
+		Flags:  allFlags,
+		Before: before,
+		Action: action,
+	}
+}
+
+// gtfsFlags are the flags controlling the static GTFS input, shared by every mode
+// except positions
+func gtfsFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "gtfs-file",
+			Value: "https://mkuran.pl/gtfs/warsaw.zip",
+			Usage: "path/URL to static Warsaw GTFS",
+		},
+		&cli.DurationFlag{
+			Name:  "checkdata",
+			Value: 30 * time.Minute,
+			Usage: "loop mode: how often to check if -gtfs-file has changed",
+		},
+	}
+}
+
+// outputFlags are the flags controlling where generated feeds are published
+func outputFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "target",
+			Value: "data_rt",
+			Usage: "where to publish created feeds: a directory, or s3://, gs://, webdav://",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "also save JSON files alongside GTFS-Realtime feeds",
+		},
+		&cli.BoolFlag{
+			Name:  "readable",
+			Usage: "indent the JSON files written by -json; GTFS-Realtime feeds are always written in binary format",
+		},
+	}
+}
+
+// loopFlags are the flags controlling loop mode, shared by every mode
+func loopFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "loop",
+			Usage: "instead of running once and exiting, update the output every given duration",
+		},
+	}
+}
+
+// metricsFlags are the flags controlling the optional Prometheus/healthz server
+func metricsFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "metrics-addr",
+			Usage: "serve Prometheus metrics and a /healthz endpoint on this address, e.g. :9090",
+		},
+		&cli.DurationFlag{
+			Name:  "stale-after",
+			Usage: "loop mode: /healthz fails once no build has succeeded for this long",
+		},
+	}
+}
+
+func apikeyFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:     "apikey",
+		Aliases:  []string{"k"},
+		Usage:    "apikey for api.um.warszawa.pl",
+		Required: true,
+	}
+}
+
+func brigadesFileFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "brigades-file",
+		Value: "https://mkuran.pl/gtfs/warsaw/brigades.json",
+		Usage: "path/URL to file brigades.json",
+	}
+}
+
+func strictFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "strict",
+		Usage: "treat ignorable scraping/matching errors as fatal",
+	}
+}
+
+// servingFlags are the flags controlling the optional built-in publishing
+// endpoint on top of -target
+func servingFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "serve",
+			Usage: "if set, also serve the generated feeds over HTTP on this address, e.g. :8080",
+		},
+		&cli.StringFlag{
+			Name: "signing-key",
+			Usage: "path to an Ed25519 PEM private key; signs each served feed as <feed>.sig " +
+				"(bootstrap one with the generate-key subcommand)",
+		},
+	}
+}
+
+// generateKeyCommand bootstraps an Ed25519 signing key for -signing-key
+func generateKeyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "generate-key",
+		Usage: "bootstrap an Ed25519 signing key for -signing-key",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "out",
+				Value: "signing-key.pem",
+				Usage: "where to write the new PEM private key",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			path := ctx.String("out")
+			if err := serve.GenerateKey(path); err != nil {
+				return err
+			}
+			logger.Info("Wrote new Ed25519 signing key", "path", path)
+			return nil
+		},
+	}
+}
+
+// setupObservability starts the metrics/healthz server (if -metrics-addr is set),
+// builds the output Sink from -target, and wraps it with an in-memory buffer
+// served over HTTP (if -serve is set)
+func setupObservability(ctx *cli.Context) (*metrics.Registry, sink.Sink, error) {
+	registry := metrics.NewRegistry(ctx.Duration("stale-after"))
+	if addr := ctx.String("metrics-addr"); addr != "" {
+		serveMetrics(addr, registry)
 	}
 
+	outSink, err := sink.New(ctx.String("target"))
 	if err != nil {
-		return
+		return nil, nil, err
 	}
 
-	// Load data
-	if *flagAlerts {
-		log.Println("Loading routes.txt")
-		if routesFile := gtfsFile.GetZipFileByName("routes.txt"); routesFile != nil {
-			err = gtfsFile.LoadRoutes(routesFile)
-		} else {
-			err = errors.New("no file routes.txt in the GTFS")
+	if addr := ctx.String("serve"); addr != "" {
+		outSink, err = addServing(addr, ctx.String("signing-key"), outSink)
+		if err != nil {
+			return nil, nil, err
 		}
-	} else {
-		log.Println("Loading data from the GTFS")
-		err = gtfsFile.LoadAll()
 	}
 
-	return
+	return registry, outSink, nil
 }
 
-// mainAlerts prepares options for creating alerts and then creates them
-func mainAlerts() (err error) {
-	// Create options struct
-	opts := alerts.Options{
-		GtfsRtTarget:    path.Join(*flagTarget, "alerts.pb"),
-		HumanReadable:   *flagReadable,
-		ThrowLinkErrors: *flagStrict,
+// addServing starts the HTTP publishing endpoint and returns a Sink that keeps
+// it up to date alongside the originally configured outSink
+func addServing(addr, signingKeyPath string, outSink sink.Sink) (sink.Sink, error) {
+	var signKey ed25519.PrivateKey
+	if signingKeyPath != "" {
+		var err error
+		if signKey, err = serve.LoadKey(signingKeyPath); err != nil {
+			return nil, err
+		}
 	}
-	if *flagJSON {
-		opts.JSONTarget = path.Join(*flagTarget, "alerts.json")
+
+	store := serve.NewStore(signKey)
+	go func() {
+		logger.Info("Serving feeds", "addr", addr)
+		if err := http.ListenAndServe(addr, store.Handler()); err != nil {
+			logger.Error("Serve error", "error", err.Error())
+		}
+	}()
+
+	return sink.Multi{outSink, store.Sink()}, nil
+}
+
+// serveMetrics starts the metrics/healthz HTTP server in the background
+func serveMetrics(addr string, registry *metrics.Registry) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", registry.Handler())
+	mux.HandleFunc("/healthz", registry.HealthzHandler())
+
+	go func() {
+		logger.Info("Serving metrics", "addr", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logger.Error("Metrics server error", "error", err.Error())
+		}
+	}()
+}
+
+// loadGtfsFile retrieves the GTFS from a path or URL
+func loadGtfsFile(source string) (*gtfs.Gtfs, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return gtfs.NewGtfsFromURL(source, client)
 	}
+	return gtfs.NewGtfsFromFile(source)
+}
 
-	// Make alerts
-	log.Println("Creating Alerts feed")
-	err = alerts.Make(client, gtfsFile.Routes, opts)
-	return
+// gtfsResourceFrom builds the util.Resource used to hot-reload the static GTFS in
+// loop mode
+func gtfsResourceFrom(ctx *cli.Context) util.Resource {
+	source := ctx.String("gtfs-file")
+	period := ctx.Duration("checkdata")
+
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return &util.ResourceHTTP{Client: client, URL: source, Peroid: period}
+	}
+	return &util.ResourceLocal{Path: source, Peroid: period}
 }
 
-// loopAlerts prepares options for launching laerts in a loop mode and then launches the loop mode
-func loopAlerts() error {
-	// Create options struct
+// gtfsSupplierFrom builds the util.GtfsSupplier used to hot-reload the static
+// GTFS in loop mode. The returned supplier may be shared across several
+// concurrent loops, e.g. by runAll, so the GTFS is only ever parsed once per
+// change no matter how many feeds are being generated from it.
+func gtfsSupplierFrom(ctx *cli.Context) *util.GtfsSupplier {
+	return &util.GtfsSupplier{Client: client, Resource: gtfsResourceFrom(ctx), Logger: logger}
+}
+
+// localSinkDir returns the directory a Sink writes to, if it (or one of the
+// sinks it wraps) is a local directory, so runAll can read back brigades.json
+// it just wrote instead of re-fetching the possibly stale -brigades-file.
+func localSinkDir(s sink.Sink) (string, bool) {
+	switch s := s.(type) {
+	case *sink.Local:
+		return s.Dir, true
+	case sink.Multi:
+		for _, inner := range s {
+			if dir, ok := localSinkDir(inner); ok {
+				return dir, true
+			}
+		}
+	}
+	return "", false
+}
+
+// alertsCommand creates a GTFS-Realtime alerts feed
+func alertsCommand() *cli.Command {
+	flags := concatFlags(gtfsFlags(), outputFlags(), loopFlags(), metricsFlags(), servingFlags(), []cli.Flag{strictFlag()})
+	return command("alerts", "create a GTFS-Realtime alerts feed", flags, runAlerts)
+}
+
+func runAlerts(ctx *cli.Context) error {
+	registry, outSink, err := setupObservability(ctx)
+	if err != nil {
+		return err
+	}
+
 	opts := alerts.Options{
-		GtfsRtTarget:    path.Join(*flagTarget, "alerts.pb"),
-		HumanReadable:   *flagReadable,
-		ThrowLinkErrors: *flagStrict,
+		Sink:            outSink,
+		GtfsRtName:      "alerts.pb",
+		HumanReadable:   ctx.Bool("readable"),
+		ThrowLinkErrors: ctx.Bool("strict"),
+		Metrics:         registry,
+		Logger:          logger,
 	}
-	if *flagJSON {
-		opts.JSONTarget = path.Join(*flagTarget, "alerts.json")
+	if ctx.Bool("json") {
+		opts.JSONName = "alerts.json"
 	}
 
-	// Create the resource with data
-	var gtfsResource util.Resource
-	if strings.HasPrefix(*flagGtfsFile, "http://") || strings.HasPrefix(*flagGtfsFile, "https://") {
-		gtfsResource = &util.ResourceHTTP{
-			Client: client, URL: *flagGtfsFile, Peroid: *flagDataCheck,
-		}
-	} else {
-		gtfsResource = &util.ResourceLocal{Path: *flagGtfsFile, Peroid: *flagDataCheck}
+	if loop := ctx.Duration("loop"); loop > 0 {
+		return alerts.Loop(client, gtfsSupplierFrom(ctx), loop, opts)
+	}
+
+	gtfsFile, err := loadGtfsFile(ctx.String("gtfs-file"))
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Loading routes.txt")
+	routesFile := gtfsFile.GetZipFileByName("routes.txt")
+	if routesFile == nil {
+		return errors.New("no file routes.txt in the GTFS")
+	}
+	if err := gtfsFile.LoadRoutes(routesFile); err != nil {
+		return err
 	}
 
-	// Call alerts.Loop
-	return alerts.Loop(client, gtfsResource, *flagLoop, opts)
+	logger.Info("Creating Alerts feed")
+	return alerts.Make(client, gtfsFile.Routes, opts)
 }
 
-// mainBrigades prepares options for creating brigades and then creates them
-func mainBrigades() (err error) {
-	if *flagApikey == "" {
-		return errors.New("Key for api.um.warszawa.pl needs to be provided")
+// brigadesCommand creates brigades.json, required by positions and trip updates
+func brigadesCommand() *cli.Command {
+	flags := concatFlags(gtfsFlags(), outputFlags(), loopFlags(), metricsFlags(), servingFlags(),
+		[]cli.Flag{strictFlag()})
+	return command("brigades", "create brigades.json (required for positions and trip updates)", flags, runBrigades)
+}
+
+func runBrigades(ctx *cli.Context) error {
+	registry, outSink, err := setupObservability(ctx)
+	if err != nil {
+		return err
 	}
 
-	// Create options struct
 	opts := brigades.Options{
-		JSONTarget:     path.Join(*flagTarget, "brigades.json"),
-		Apikey:         *flagApikey,
-		ThrowAPIErrors: *flagStrict,
+		Sink:           outSink,
+		JSONName:       "brigades.json",
+		ThrowAPIErrors: ctx.Bool("strict"),
+		Metrics:        registry,
+		Logger:         logger,
 	}
-	// Make alerts
-	log.Println("Creating brigades.json")
-	err = brigades.Main(client, gtfsFile, opts)
-	return
+
+	if loop := ctx.Duration("loop"); loop > 0 {
+		return brigades.Loop(client, gtfsSupplierFrom(ctx), loop, opts)
+	}
+
+	gtfsFile, err := loadGtfsFile(ctx.String("gtfs-file"))
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Loading data from the GTFS")
+	if err := gtfsFile.LoadAll(); err != nil {
+		return err
+	}
+
+	logger.Info("Creating brigades.json")
+	return brigades.Main(client, gtfsFile, opts)
 }
 
-// mainPositions parses options for creating vehicle positions and then creates them
-func mainPositions() (err error) {
-	if *flagApikey == "" {
-		return errors.New("Key for api.um.warszawa.pl needs to be provided")
+// positionsCommand creates a GTFS-Realtime vehicle positions feed
+func positionsCommand() *cli.Command {
+	flags := concatFlags(outputFlags(), loopFlags(), metricsFlags(), servingFlags(),
+		[]cli.Flag{apikeyFlag(), brigadesFileFlag()})
+	return command("positions", "create a GTFS-Realtime vehicle positions feed", flags, runPositions)
+}
+
+func runPositions(ctx *cli.Context) error {
+	registry, outSink, err := setupObservability(ctx)
+	if err != nil {
+		return err
 	}
 
-	// Create options struct
 	opts := positions.Options{
-		GtfsRtTarget:  path.Join(*flagTarget, "positions.pb"),
-		HumanReadable: *flagReadable,
-		Apikey:        *flagApikey,
-		Brigades:      *flagBrigadesFile,
+		Sink:          outSink,
+		GtfsRtName:    "positions.pb",
+		HumanReadable: ctx.Bool("readable"),
+		Apikey:        ctx.String("apikey"),
+		Brigades:      ctx.String("brigades-file"),
+		Metrics:       registry,
+		Logger:        logger,
 	}
-	if *flagJSON {
-		opts.JSONTarget = path.Join(*flagTarget, "positions.json")
+	if ctx.Bool("json") {
+		opts.JSONName = "positions.json"
 	}
 
-	// Make alerts
-	log.Println("Creating brigades.json")
-	err = positions.Main(client, opts)
-	return
+	if loop := ctx.Duration("loop"); loop > 0 {
+		return positions.Loop(client, loop, opts)
+	}
+
+	logger.Info("Creating GTFS-Realtime positions feed")
+	return positions.Main(client, opts)
 }
 
-// Main functionality
-func main() {
-	var err error
+// tripUpdatesCommand creates a GTFS-Realtime trip updates feed
+func tripUpdatesCommand() *cli.Command {
+	flags := concatFlags(gtfsFlags(), outputFlags(), loopFlags(), metricsFlags(), servingFlags(),
+		[]cli.Flag{apikeyFlag(), brigadesFileFlag()})
+	return command("tripupdates", "create a GTFS-Realtime trip updates feed", flags, runTripUpdates)
+}
 
-	// Parse CL flags
-	flag.Parse()
+func runTripUpdates(ctx *cli.Context) error {
+	registry, outSink, err := setupObservability(ctx)
+	if err != nil {
+		return err
+	}
 
-	// Check excluding flags
-	loopMode := *flagLoop > 0
-	err = checkModes()
+	opts := tripupdates.Options{
+		Sink:          outSink,
+		GtfsRtName:    "trip_updates.pb",
+		HumanReadable: ctx.Bool("readable"),
+		Apikey:        ctx.String("apikey"),
+		Brigades:      ctx.String("brigades-file"),
+		Metrics:       registry,
+		Logger:        logger,
+	}
+	if ctx.Bool("json") {
+		opts.JSONName = "trip_updates.json"
+	}
+
+	if loop := ctx.Duration("loop"); loop > 0 {
+		return tripupdates.Loop(client, gtfsSupplierFrom(ctx), loop, opts)
+	}
+
+	gtfsFile, err := loadGtfsFile(ctx.String("gtfs-file"))
 	if err != nil {
-		log.Fatalln(err.Error())
+		return err
 	}
 
-	// Load gtfs
-	if !*flagPostions && !loopMode {
-		err = loadGtfs()
-		if err != nil {
-			log.Fatalln(err.Error())
+	logger.Info("Loading stop_times.txt")
+	stopTimesFile := gtfsFile.GetZipFileByName("stop_times.txt")
+	if stopTimesFile == nil {
+		return errors.New("no file stop_times.txt in the GTFS")
+	}
+	if err := gtfsFile.LoadStopTimes(stopTimesFile); err != nil {
+		return err
+	}
+	if stopsFile := gtfsFile.GetZipFileByName("stops.txt"); stopsFile != nil {
+		if err := gtfsFile.LoadStops(stopsFile); err != nil {
+			return err
 		}
 	}
 
-	// Launch specified mode
-	switch {
-	case *flagAlerts && loopMode:
-		err = loopAlerts()
-	case *flagAlerts:
-		err = mainAlerts()
-	case loopMode:
-		err = errors.New("loop mode is only available for alerts")
-	case *flagBrigades:
-		err = mainBrigades()
-	case *flagPostions:
-		err = mainPositions()
+	logger.Info("Creating TripUpdates feed")
+	return tripupdates.Main(client, gtfsFile, opts)
+}
+
+// allCommand concurrently runs alerts, brigades, positions and trip updates in one
+// process, sharing the GTFS resource and HTTP client instead of requiring one
+// process per mode
+func allCommand() *cli.Command {
+	flags := concatFlags(gtfsFlags(), outputFlags(), loopFlags(), metricsFlags(), servingFlags(),
+		[]cli.Flag{apikeyFlag(), brigadesFileFlag(), strictFlag()})
+	return command("all", "run alerts, brigades, positions and trip updates concurrently", flags, runAll)
+}
+
+func runAll(ctx *cli.Context) error {
+	loop := ctx.Duration("loop")
+	if loop <= 0 {
+		return errors.New("the all subcommand requires -loop to be set")
 	}
 
+	registry, outSink, err := setupObservability(ctx)
 	if err != nil {
-		log.Fatalln(err.Error())
+		return err
 	}
+
+	// gtfsSrc is shared by the alerts, brigades and trip updates loops below,
+	// so the static GTFS is parsed at most once per change no matter how many
+	// modes watch it
+	gtfsSrc := gtfsSupplierFrom(ctx)
+	gtfsFile, err := gtfsSrc.Get()
+	if err != nil {
+		return err
+	}
+
+	brigadesOpts := brigades.Options{
+		Sink:           outSink,
+		JSONName:       "brigades.json",
+		ThrowAPIErrors: ctx.Bool("strict"),
+		Metrics:        registry,
+		Logger:         logger,
+	}
+	logger.Info("Creating brigades.json")
+	if err := brigades.Main(client, gtfsFile, brigadesOpts); err != nil {
+		return err
+	}
+
+	// positions and tripupdates read back the brigades.json that was just
+	// seeded above instead of -brigades-file, which may point at a stale
+	// remote mirror; fall back to it only if outSink isn't a local directory
+	// we can read from directly.
+	brigadesSource := ctx.String("brigades-file")
+	if dir, ok := localSinkDir(outSink); ok {
+		brigadesSource = filepath.Join(dir, "brigades.json")
+	} else {
+		logger.Warn("Output target isn't a local directory; positions and tripupdates will use "+
+			"-brigades-file instead of the brigades.json just generated", "brigades-file", brigadesSource)
+	}
+
+	alertsOpts := alerts.Options{
+		Sink:            outSink,
+		GtfsRtName:      "alerts.pb",
+		HumanReadable:   ctx.Bool("readable"),
+		ThrowLinkErrors: ctx.Bool("strict"),
+		Metrics:         registry,
+		Logger:          logger,
+	}
+	positionsOpts := positions.Options{
+		Sink:          outSink,
+		GtfsRtName:    "positions.pb",
+		HumanReadable: ctx.Bool("readable"),
+		Apikey:        ctx.String("apikey"),
+		Brigades:      brigadesSource,
+		Metrics:       registry,
+		Logger:        logger,
+	}
+	tripUpdatesOpts := tripupdates.Options{
+		Sink:          outSink,
+		GtfsRtName:    "trip_updates.pb",
+		HumanReadable: ctx.Bool("readable"),
+		Apikey:        ctx.String("apikey"),
+		Brigades:      brigadesSource,
+		Metrics:       registry,
+		Logger:        logger,
+	}
+	if ctx.Bool("json") {
+		alertsOpts.JSONName = "alerts.json"
+		positionsOpts.JSONName = "positions.json"
+		tripUpdatesOpts.JSONName = "trip_updates.json"
+	}
+
+	errs := make(chan error, 4)
+	go func() { errs <- alerts.Loop(client, gtfsSrc, loop, alertsOpts) }()
+	go func() { errs <- brigades.Loop(client, gtfsSrc, loop, brigadesOpts) }()
+	go func() { errs <- positions.Loop(client, loop, positionsOpts) }()
+	go func() { errs <- tripupdates.Loop(client, gtfsSrc, loop, tripUpdatesOpts) }()
+
+	return <-errs
 }